@@ -0,0 +1,50 @@
+package main
+
+import (
+	"image"
+	"log"
+
+	"gocv.io/x/gocv"
+)
+
+// localDetector runs a cheap local face detection pass (a Haar cascade) so
+// that capture() only pays for a recognizer call — cloud or local — on
+// frames that actually contain a face. The cascade is a best-effort
+// pre-filter, not a requirement: if it fails to load, Detect degrades to
+// passing every frame through instead of the appliance refusing to start.
+type localDetector struct {
+	classifier gocv.CascadeClassifier
+	loaded     bool
+}
+
+func newLocalDetector(cascadeFile string) (*localDetector, error) {
+	classifier := gocv.NewCascadeClassifier()
+	if !classifier.Load(cascadeFile) {
+		classifier.Close()
+		log.Printf("cascade classifier unavailable (%s), disabling local pre-filter", cascadeFile)
+		return &localDetector{}, nil
+	}
+	return &localDetector{classifier: classifier, loaded: true}, nil
+}
+
+func (d *localDetector) Close() error {
+	if !d.loaded {
+		return nil
+	}
+	return d.classifier.Close()
+}
+
+// Detect returns the bounding boxes of every face found in frame. If no
+// cascade was loaded it returns the whole frame, so callers still pass every
+// frame on to the recognizer rather than skipping detection entirely.
+func (d *localDetector) Detect(frame gocv.Mat) []image.Rectangle {
+	if !d.loaded {
+		return []image.Rectangle{image.Rect(0, 0, frame.Cols(), frame.Rows())}
+	}
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(frame, &gray, gocv.ColorBGRToGray)
+
+	return d.classifier.DetectMultiScale(gray)
+}
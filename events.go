@@ -0,0 +1,58 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// RecognitionEvent describes a single face recognition result, published so
+// that the web UI can show what the camera is seeing in real time.
+type RecognitionEvent struct {
+	Key        FaceKey         `json:"key"`
+	Similarity float64         `json:"similarity"`
+	Box        image.Rectangle `json:"box"`
+	Thumbnail  []byte          `json:"thumbnail"` // JPEG bytes of the cropped face
+	Time       time.Time       `json:"time"`
+}
+
+// eventBroker fans RecognitionEvents out to any number of subscribers, e.g.
+// the /events SSE handler. Publishing never blocks on a slow subscriber: a
+// full subscriber channel simply drops the event.
+type eventBroker struct {
+	mu   sync.Mutex
+	subs map[chan RecognitionEvent]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subs: make(map[chan RecognitionEvent]struct{})}
+}
+
+func (b *eventBroker) Publish(ev RecognitionEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a cancel func that must
+// be called once the subscriber is done reading from it.
+func (b *eventBroker) Subscribe() (<-chan RecognitionEvent, func()) {
+	ch := make(chan RecognitionEvent, 16)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+		close(ch)
+	}
+	return ch, cancel
+}
@@ -0,0 +1,26 @@
+package main
+
+import "sync"
+
+// frameCache holds the most recently captured JPEG frame so that the
+// /capture.jpg HTTP handler can serve it without touching the camera.
+type frameCache struct {
+	mu   sync.RWMutex
+	jpeg []byte
+}
+
+func newFrameCache() *frameCache {
+	return &frameCache{}
+}
+
+func (c *frameCache) Set(jpegBytes []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jpeg = jpegBytes
+}
+
+func (c *frameCache) Get() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.jpeg
+}
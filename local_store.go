@@ -1,20 +1,38 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 var cataloguePat = regexp.MustCompile("/catalogue/([\\w]+)/([-\\w]+)\\.jpg")
 
+// watchDebounce coalesces bursts of catalogue filesystem events (e.g. an
+// editor writing a file in several steps) into a single sync.
+const watchDebounce = 500 * time.Millisecond
+
+// pollInterval is how often the polling fallback re-scans the catalogue on
+// platforms where fsnotify can't watch the filesystem.
+const pollInterval = 10 * time.Second
+
 type LocalStore struct {
-	baseDir  string
-	lastSync time.Time
+	baseDir   string
+	lastSync  time.Time
+	metadata  *metadataBatcher
+	metaCache sync.Map // FaceKey -> FaceMetadata, refreshed on each sync
+}
+
+func (store *LocalStore) BaseDir() string {
+	return store.baseDir
 }
 
 func (store *LocalStore) guestDir() string {
@@ -36,20 +54,78 @@ func (store *LocalStore) Setup() error {
 			return err
 		}
 	}
+
+	metadata, err := newMetadataBatcher()
+	if err != nil {
+		// exiftool is optional: metadata extraction is a nice-to-have for
+		// detection records, not a requirement to run the camera.
+		log.Print("metadata extraction disabled, exiftool unavailable: ", err)
+	} else {
+		store.metadata = metadata
+	}
 	return nil
 }
 
-func (store *LocalStore) RecordDetectedName(now time.Time, name string) error {
+// RecordDetectedName writes a record of key having been seen at now,
+// annotated with whatever catalogue metadata (display name, enrollment
+// date, tags) is cached for it. It reads from metaCache rather than
+// extracting metadata itself, since this is called once per detected face
+// per frame and exiftool extraction is too slow to do on that path.
+func (store *LocalStore) RecordDetectedName(now time.Time, key FaceKey) error {
 	dateFolder := filepath.Join(store.recordDir(), "detected", now.Format("20060102"))
 	if err := os.MkdirAll(dateFolder, 0755); err != nil {
 		return err
 	}
-	f, err := os.OpenFile(filepath.Join(dateFolder, now.Format("20060102150405")+"-"+name), os.O_CREATE|os.O_WRONLY, 644)
+
+	f, err := os.OpenFile(filepath.Join(dateFolder, now.Format("20060102150405")+"-"+key.Name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return nil
+	return json.NewEncoder(f).Encode(store.cachedMetadata(key))
+}
+
+// cachedMetadata returns the last metadata refreshMetadataCache cached for
+// key, or a name-only fallback if it was never enrolled or the extraction
+// failed.
+func (store *LocalStore) cachedMetadata(key FaceKey) FaceMetadata {
+	if v, ok := store.metaCache.Load(key); ok {
+		return v.(FaceMetadata)
+	}
+	return FaceMetadata{DisplayName: key.Name}
+}
+
+// ReadMetadata extracts EXIF/XMP metadata from the catalogue image key was
+// enrolled from. If exiftool isn't available it degrades to a name-only
+// FaceMetadata rather than erroring.
+func (store *LocalStore) ReadMetadata(key FaceKey) (FaceMetadata, error) {
+	if store.metadata == nil {
+		return FaceMetadata{DisplayName: key.Name}, nil
+	}
+	path := filepath.Join(store.catalogueDir(), key.Name, key.Index+".jpg")
+	return store.metadata.Read(path)
+}
+
+// refreshMetadataCache re-extracts metadata for every key in the catalogue
+// and stores it in metaCache, so RecordDetectedName never has to wait on
+// exiftool while a frame is being processed. Keys are fed to the batcher
+// concurrently so it actually gets to batch them into one ExtractMetadata
+// call instead of flushing a batch of one per metadataBatchWait.
+func (store *LocalStore) refreshMetadataCache(keys []FaceKey) {
+	var wg sync.WaitGroup
+	wg.Add(len(keys))
+	for _, k := range keys {
+		go func(k FaceKey) {
+			defer wg.Done()
+			meta, err := store.ReadMetadata(k)
+			if err != nil {
+				log.Printf("ReadMetadata(%v): %s", k, err)
+				meta = FaceMetadata{DisplayName: k.Name}
+			}
+			store.metaCache.Store(k, meta)
+		}(k)
+	}
+	wg.Wait()
 }
 
 func (store *LocalStore) SaveGuest(img []byte, idx int) error {
@@ -64,6 +140,57 @@ func (store *LocalStore) ReadImage(key FaceKey) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+// ListGuests returns the ids (file names) of every guest photo waiting to be
+// either identified or enrolled under a name.
+func (store *LocalStore) ListGuests() ([]string, error) {
+	entries, err := ioutil.ReadDir(store.guestDir())
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ids = append(ids, e.Name())
+	}
+	return ids, nil
+}
+
+func (store *LocalStore) ReadGuest(id string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(store.guestDir(), filepath.Base(id)))
+}
+
+// PromoteGuest moves a guest photo into the catalogue under name, enrolling
+// it the next time the catalogue is synced.
+func (store *LocalStore) PromoteGuest(id, name string) error {
+	img, err := store.ReadGuest(id)
+	if err != nil {
+		return err
+	}
+	if _, err := store.SaveCatalogueImage(name, img); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(store.guestDir(), filepath.Base(id)))
+}
+
+// SaveCatalogueImage enrolls img as a new catalogue entry for name, returning
+// the FaceKey it was saved under.
+func (store *LocalStore) SaveCatalogueImage(name string, img []byte) (FaceKey, error) {
+	dir := filepath.Join(store.catalogueDir(), name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return FaceKey{}, err
+	}
+
+	index := fmt.Sprintf("%d", time.Now().UnixNano())
+	path := filepath.Join(dir, index+".jpg")
+	if err := ioutil.WriteFile(path, img, 0644); err != nil {
+		return FaceKey{}, err
+	}
+	log.Print("Saving catalogue photo: ", path)
+	return FaceKey{Name: name, Index: index}, nil
+}
+
 func (store *LocalStore) Watch(synccb SyncFunc) error {
 	if _, err := os.Stat(store.catalogueDir()); err != nil {
 		if os.IsNotExist(err) {
@@ -72,23 +199,96 @@ func (store *LocalStore) Watch(synccb SyncFunc) error {
 		}
 		return err
 	}
+
+	if err := store.sync(synccb); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Print("fsnotify unavailable, falling back to polling: ", err)
+		go store.pollLoop(synccb)
+		return nil
+	}
+	if err := addWatchesRecursive(watcher, store.catalogueDir()); err != nil {
+		watcher.Close()
+		return err
+	}
+
 	log.Print("Start to watch catalogue folder updates.")
+	go store.watchLoop(watcher, synccb)
+	return nil
+}
 
-	go func() {
+// watchLoop consumes fsnotify events for the catalogue tree, watching any
+// newly created subdirectory as it appears, and debounces bursts of events
+// into a single sync call.
+func (store *LocalStore) watchLoop(watcher *fsnotify.Watcher, synccb SyncFunc) {
+	defer watcher.Close()
+
+	var debounce *time.Timer
+	sync := func() {
 		if err := store.sync(synccb); err != nil {
 			log.Print("LocalStore.Watch: ", err)
-			return
 		}
-		time.Sleep(10 * time.Second)
-	}()
-	return nil
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addWatchesRecursive(watcher, event.Name); err != nil {
+						log.Print("fsnotify: ", err)
+					}
+				}
+			}
+			if debounce == nil {
+				debounce = time.AfterFunc(watchDebounce, sync)
+			} else {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Print("fsnotify error: ", err)
+		}
+	}
+}
+
+// pollLoop is the fallback used on platforms without inotify support.
+func (store *LocalStore) pollLoop(synccb SyncFunc) {
+	for {
+		time.Sleep(pollInterval)
+		if err := store.sync(synccb); err != nil {
+			log.Print("LocalStore.Watch: ", err)
+		}
+	}
+}
+
+// addWatchesRecursive registers a watch on root and every directory beneath
+// it, since fsnotify does not watch subtrees on its own.
+func addWatchesRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
 }
 
 func (store *LocalStore) sync(synccb SyncFunc) error {
 	keys := []FaceKey{}
 	var lastMod time.Time
 	err := filepath.Walk(store.catalogueDir(), func(path string, info os.FileInfo, err error) error {
-		if lastMod.After(info.ModTime()) {
+		if info.ModTime().After(lastMod) {
 			lastMod = info.ModTime()
 		}
 
@@ -108,6 +308,8 @@ func (store *LocalStore) sync(synccb SyncFunc) error {
 		return nil
 	}
 
+	store.refreshMetadataCache(keys)
+
 	if err := synccb(keys); err != nil {
 		return err
 	}
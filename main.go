@@ -7,30 +7,34 @@ import (
 	"image"
 	"io/ioutil"
 	"log"
-	"math"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/rekognition"
 	"gocv.io/x/gocv"
 )
 
 var settings struct {
 	WebCamDevID                string
+	Recognizer                 string
 	AwsRegion                  string
 	AwsAccessKeyID             string
 	AwsSecretAccessKey         string
 	AwsRekognitionCollectionID string
+	DlibModelsDir              string
+	HaarCascadeFile            string
+	HTTPAddr                   string
 }
 
 func init() {
 	flag.StringVar(&settings.WebCamDevID, "device", "0", "Web camera device ID")
+	flag.StringVar(&settings.Recognizer, "recognizer", "aws", "Face recognition backend to use: aws or dlib")
 	flag.StringVar(&settings.AwsRegion, "aws-region", "us-east-1", "AWS Region")
 	flag.StringVar(&settings.AwsRekognitionCollectionID, "aws-collection-id", "", "AWS Rekognition Collection ID")
+	flag.StringVar(&settings.DlibModelsDir, "dlib-models-dir", "models", "Directory containing the dlib face detection, shape predictor and recognition models")
+	flag.StringVar(&settings.HaarCascadeFile, "haar-cascade", "haarcascade_frontalface_default.xml", "Haar cascade file used to pre-filter frames before calling the recognizer")
+	flag.StringVar(&settings.HTTPAddr, "http-addr", ":8080", "Address the control HTTP server listens on")
 
 	settings.AwsAccessKeyID = os.Getenv("AWS_ACCESS_KEY")
 	settings.AwsSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
@@ -38,10 +42,26 @@ func init() {
 
 func main() {
 	flag.Parse()
-	if settings.AwsRekognitionCollectionID == "" {
-		log.Print("-aws-collection-id is unset")
+
+	store := &LocalStore{baseDir: "localstore"}
+	if err := store.Setup(); err != nil {
+		log.Printf("%T: %s", store, err)
+		return
+	}
+
+	recognizer, err := newRecognizer(store)
+	if err != nil {
+		log.Print("newRecognizer: ", err)
+		return
+	}
+	defer recognizer.Close()
+
+	detector, err := newLocalDetector(settings.HaarCascadeFile)
+	if err != nil {
+		log.Print("newLocalDetector: ", err)
 		return
 	}
+	defer detector.Close()
 
 	// open webcam
 	webcam, err := gocv.OpenVideoCapture(settings.WebCamDevID)
@@ -54,31 +74,47 @@ func main() {
 	webcam.Set(gocv.VideoCaptureFrameHeight, 480.0)
 	log.Printf("capure depth: %d x %d", int(webcam.Get(gocv.VideoCaptureFrameWidth)), int(webcam.Get(gocv.VideoCaptureFrameHeight)))
 
-	store := &LocalStore{baseDir: "localstore"}
-	if err := store.Setup(); err != nil {
-		log.Printf("%T: %s", store, err)
-		return
-	}
+	safeStore := newSafeStore(store)
 
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region:      aws.String(settings.AwsRegion),
-		Credentials: credentials.NewStaticCredentials(settings.AwsAccessKeyID, settings.AwsSecretAccessKey, ""),
-	}))
-
-	if err := watch(store, sess); err != nil {
+	if err := watch(safeStore, recognizer); err != nil {
 		log.Print("watch: ", err)
 		return
 	}
 
+	frames := newFrameCache()
+	events := newEventBroker()
+	server := newServer(safeStore, frames, events)
+	go func() {
+		if err := server.Start(settings.HTTPAddr); err != nil {
+			log.Print("http server: ", err)
+		}
+	}()
+
 	// Discard first number of frames until the camera stabilizes brightness.
 	webcam.Grab(10)
+	tracker := newFaceTracker()
 	for {
-		capture(webcam, store, sess)
+		capture(webcam, safeStore, recognizer, detector, tracker, frames, events)
 	}
 
 }
 
-func capture(webcam *gocv.VideoCapture, store Store, sess *session.Session) {
+// newRecognizer builds the Recognizer backend selected by -recognizer.
+func newRecognizer(store *LocalStore) (Recognizer, error) {
+	switch settings.Recognizer {
+	case "aws":
+		if settings.AwsRekognitionCollectionID == "" {
+			return nil, errors.New("-aws-collection-id is unset")
+		}
+		return newAWSRecognizer(settings.AwsRegion, settings.AwsAccessKeyID, settings.AwsSecretAccessKey, settings.AwsRekognitionCollectionID)
+	case "dlib":
+		return newDlibRecognizer(settings.DlibModelsDir, store.BaseDir())
+	default:
+		return nil, fmt.Errorf("unknown -recognizer %q, want aws or dlib", settings.Recognizer)
+	}
+}
+
+func capture(webcam *gocv.VideoCapture, store Store, recognizer Recognizer, detector *localDetector, tracker *faceTracker, frames *frameCache, events *eventBroker) {
 	frame := gocv.NewMat()
 	defer frame.Close()
 
@@ -91,129 +127,88 @@ func capture(webcam *gocv.VideoCapture, store Store, sess *session.Session) {
 		return
 	}
 
+	tracker.Advance(frame)
+
 	jpegBytes, err := gocv.IMEncode(gocv.JPEGFileExt, frame)
 	if err != nil {
 		log.Print(err)
 		return
 	}
 	ioutil.WriteFile("capture.jpg", jpegBytes, 0644)
-
-	imageInput := &rekognition.Image{
-		Bytes: jpegBytes,
-	}
-
-	reko := rekognition.New(sess)
-
-	faceArea, err := func() ([]image.Rectangle, error) {
-
-		input := &rekognition.DetectFacesInput{
-			Image: imageInput,
-		}
-
-		output, err := reko.DetectFaces(input)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-
-		res := make([]image.Rectangle, len(output.FaceDetails))
-		log.Print(output)
-		for idx, f := range output.FaceDetails {
-			// DetectFaces API can return the bounding box value in out of image dimension.
-			// They needs to be capped from 0.0 to 1.0.
-			rect := image.Rect(
-				int(math.Max(*f.BoundingBox.Left*float64(frame.Cols()), 0.0)),
-				int(math.Max(*f.BoundingBox.Top*float64(frame.Rows()), 0.0)),
-				int(math.Min(*f.BoundingBox.Left+*f.BoundingBox.Width, 1.0)*float64(frame.Cols())),
-				int(math.Min(*f.BoundingBox.Top+*f.BoundingBox.Height, 1.0)*float64(frame.Rows())),
-			)
-
-			res[idx] = rect
-		}
-		return res, nil
-	}()
-	if err != nil {
+	frames.Set(jpegBytes)
+
+	// Run the cheap local detector before any recognition and skip the rest
+	// of the frame if it sees nothing, so the recognizer (which may be a paid
+	// cloud call) only looks at frames the detector found a face in (every
+	// frame, when no cascade was loaded).
+	faceArea := detector.Detect(frame)
+	if len(faceArea) == 0 {
 		return
 	}
 
-	identify := func(jpegBytes []byte, idx int) error {
-
-		imageInput := &rekognition.Image{
-			Bytes: jpegBytes,
-		}
-		input := &rekognition.SearchFacesByImageInput{
-			CollectionId: aws.String(settings.AwsRekognitionCollectionID),
-			Image:        imageInput,
-		}
-		output, err := reko.SearchFacesByImage(input)
+	identify := func(jpegBytes []byte, idx int) (FaceKey, float64, bool) {
+		results, err := recognizer.SearchFaces(jpegBytes)
 		if err != nil {
-			log.Println(err)
-			return err
+			return FaceKey{}, 0, false
 		}
 
-		log.Print("SeachFaceByImage result: ", len(output.FaceMatches))
+		log.Print("SearchFaces result: ", len(results))
 
-		if len(output.FaceMatches) == 0 {
+		if len(results) == 0 {
 			if err := store.SaveGuest(jpegBytes, idx); err != nil {
 				log.Printf("%T: %s", store, err)
 			}
-			return nil
+			return FaceKey{}, 0, false
 		}
 
-		results := []faceSimilarity{}
-		for _, f := range output.FaceMatches {
-			if f.Face.ExternalImageId == nil {
-				log.Print("Found but no exterImageId attribute: face_id=", *f.Face.FaceId)
-				continue
-			}
-			k, err := ParseFaceKey(*f.Face.ExternalImageId)
-			if err != nil {
-				continue
-			}
-			results = append(results, faceSimilarity{k, *f.Similarity})
-		}
-		if len(results) == 0 {
-			return nil
-		}
-		sort.Sort(bySimilarity(results))
-		log.Print("Identified: ", results[0].Key.Name)
-
-		return nil
+		sort.Sort(sort.Reverse(byMatchSimilarity(results)))
+		return results[0].Key, results[0].Similarity, true
 	}
 
 	for idx, r := range faceArea {
-		func() error {
+		func() {
 			cropped := frame.Region(r)
 			defer cropped.Close()
 
-			jpegBytes, err := gocv.IMEncode(gocv.JPEGFileExt, cropped)
+			croppedJPEG, err := gocv.IMEncode(gocv.JPEGFileExt, cropped)
 			if err != nil {
 				log.Print(err)
-				return err
+				return
 			}
-			identify(jpegBytes, idx)
-			return nil
-		}()
-	}
-
-}
 
-type faceSimilarity struct {
-	Key        FaceKey
-	Similarity float64
-}
-type bySimilarity []faceSimilarity
+			// A face already under track within this box is known, so skip
+			// the recognizer call entirely. Don't record it again: it was
+			// already recorded when tracking started, and re-recording it
+			// every frame would turn the per-person record/event stream
+			// into a per-frame one for as long as the subject stays put.
+			if tracker.Match(r) != nil {
+				return
+			}
 
-func (c bySimilarity) Len() int {
-	return len(c)
-}
+			key, similarity, ok := identify(croppedJPEG, idx)
+			if !ok {
+				return
+			}
+			log.Print("Identified: ", key.Name)
+			tracker.Track(frame, r, key, similarity)
+			recordDetection(store, events, key, similarity, r, croppedJPEG)
+		}()
+	}
 
-func (c bySimilarity) Less(i, j int) bool {
-	return c[i].Similarity < c[j].Similarity
 }
 
-func (c bySimilarity) Swap(i, j int) {
-	c[i], c[j] = c[j], c[i]
+func recordDetection(store Store, events *eventBroker, key FaceKey, similarity float64, box image.Rectangle, thumbnail []byte) {
+	now := time.Now()
+	if err := store.RecordDetectedName(now, key); err != nil {
+		log.Printf("%T: %s", store, err)
+	}
+	events.Publish(RecognitionEvent{
+		Key:        key,
+		Similarity: similarity,
+		Box:        box,
+		Thumbnail:  thumbnail,
+		Time:       now,
+	})
 }
 
 type FaceKey struct {
@@ -236,72 +231,11 @@ type Store interface {
 	SaveGuest(img []byte, idx int) error
 	Watch(synccb SyncFunc) error
 	ReadImage(key FaceKey) ([]byte, error)
-}
-
-func watch(store Store, sess *session.Session) error {
-
-	synccb := func(locals []FaceKey) error {
-		reko := rekognition.New(sess)
-
-		input := &rekognition.ListFacesInput{
-			CollectionId: aws.String(settings.AwsRekognitionCollectionID),
-		}
-		output, err := reko.ListFaces(input)
-		if err != nil {
-			log.Print(err)
-			return err
-		}
-
-		registered := [][2]string{}
-		for _, f := range output.Faces {
-			if f.ExternalImageId == nil {
-				continue
-			}
-			i := strings.SplitN(*f.ExternalImageId, "_", 2)
-			if len(i) != 2 {
-				log.Print("Skipped externalImageId: ", *f.ExternalImageId)
-				continue
-			}
-
-			registered = append(registered, [2]string{i[0], i[1]})
-		}
-
-		newkeys := []FaceKey{}
-		for _, k := range locals {
-			func() {
-				for _, k2 := range registered {
-					if k.Name == k2[0] && k.Index == k2[1] {
-						return
-					}
-				}
-				newkeys = append(newkeys, k)
-			}()
-		}
-
-		for _, k := range newkeys {
-			jpegBytes, err := store.ReadImage(k)
-			if err != nil {
-				log.Print("store.ReadImage: ", err)
-				continue
-			}
-			input := &rekognition.IndexFacesInput{
-				CollectionId:    aws.String(settings.AwsRekognitionCollectionID),
-				ExternalImageId: aws.String(fmt.Sprintf("%s_%s", k.Name, k.Index)),
-				Image: &rekognition.Image{
-					Bytes: jpegBytes,
-				},
-			}
-			_, err = reko.IndexFaces(input)
-			if err != nil {
-				log.Print("rekognition.IndexFaces: ", err)
-			}
-			log.Print("Indexed new face: ", k)
-		}
-		return nil
-	}
-
-	if err := store.Watch(synccb); err != nil {
-		return err
-	}
-	return nil
+	RecordDetectedName(now time.Time, key FaceKey) error
+	ReadMetadata(key FaceKey) (FaceMetadata, error)
+	BaseDir() string
+	ListGuests() ([]string, error)
+	ReadGuest(id string) ([]byte, error)
+	PromoteGuest(id, name string) error
+	SaveCatalogueImage(name string, img []byte) (FaceKey, error)
 }
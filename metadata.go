@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+)
+
+// metadataBatchSize and metadataBatchWait bound how long a ReadMetadata call
+// waits for other calls to pile up before a batch is flushed as one exiftool
+// invocation, modeled on the dataloader-style batching photoview uses.
+const (
+	metadataBatchSize = 100
+	metadataBatchWait = 100 * time.Millisecond
+)
+
+// FaceMetadata is the EXIF/XMP information extracted from a catalogue image,
+// used to annotate detection records with more than just the ExternalImageId
+// slug.
+type FaceMetadata struct {
+	DisplayName  string
+	EnrolledAt   time.Time
+	OriginalFile string
+	Tags         []string
+}
+
+type metadataRequest struct {
+	path string
+	resp chan metadataResult
+}
+
+type metadataResult struct {
+	meta FaceMetadata
+	err  error
+}
+
+// metadataBatcher runs a single long-lived exiftool process and coalesces
+// concurrent ReadMetadata calls into batched ExtractMetadata invocations.
+type metadataBatcher struct {
+	et   *exiftool.Exiftool
+	reqs chan metadataRequest
+}
+
+func newMetadataBatcher() (*metadataBatcher, error) {
+	et, err := exiftool.NewExiftool()
+	if err != nil {
+		return nil, err
+	}
+	b := &metadataBatcher{et: et, reqs: make(chan metadataRequest)}
+	go b.loop()
+	return b, nil
+}
+
+func (b *metadataBatcher) Close() error {
+	close(b.reqs)
+	return b.et.Close()
+}
+
+// Read fetches the metadata for path, blocking until the batch it lands in
+// is flushed.
+func (b *metadataBatcher) Read(path string) (FaceMetadata, error) {
+	resp := make(chan metadataResult, 1)
+	b.reqs <- metadataRequest{path: path, resp: resp}
+	r := <-resp
+	return r.meta, r.err
+}
+
+func (b *metadataBatcher) loop() {
+	var batch []metadataRequest
+	var timerC <-chan time.Time
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		paths := make([]string, len(batch))
+		for i, req := range batch {
+			paths[i] = req.path
+		}
+		for i, fi := range b.et.ExtractMetadata(paths...) {
+			batch[i].resp <- toMetadataResult(fi)
+		}
+		batch = nil
+		timerC = nil
+	}
+
+	for {
+		select {
+		case req, ok := <-b.reqs:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, req)
+			if len(batch) >= metadataBatchSize {
+				flush()
+				continue
+			}
+			if timerC == nil {
+				timerC = time.After(metadataBatchWait)
+			}
+		case <-timerC:
+			flush()
+		}
+	}
+}
+
+func toMetadataResult(fi exiftool.FileMetadata) metadataResult {
+	if fi.Err != nil {
+		return metadataResult{err: fi.Err}
+	}
+
+	meta := FaceMetadata{OriginalFile: filepath.Base(fi.File)}
+	if v, err := fi.GetString("DateTimeOriginal"); err == nil {
+		if t, err := time.Parse("2006:01:02 15:04:05", v); err == nil {
+			meta.EnrolledAt = t
+		}
+	}
+	if v, err := fi.GetString("XMP:PersonName"); err == nil {
+		meta.DisplayName = v
+	}
+	if v, err := fi.GetString("XMP:Subject"); err == nil && v != "" {
+		meta.Tags = strings.Split(v, ",")
+	}
+	return metadataResult{meta: meta}
+}
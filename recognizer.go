@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+)
+
+// FaceMatch is a single candidate returned by Recognizer.SearchFaces, ordered
+// by Similarity as reported by the backend (0-100, higher is more confident).
+type FaceMatch struct {
+	Key        FaceKey
+	Similarity float64
+}
+
+type byMatchSimilarity []FaceMatch
+
+func (c byMatchSimilarity) Len() int           { return len(c) }
+func (c byMatchSimilarity) Less(i, j int) bool { return c[i].Similarity < c[j].Similarity }
+func (c byMatchSimilarity) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// Recognizer abstracts the face detection/recognition backend so that main.go
+// is not tied to AWS Rekognition. Implementations are free to call out to a
+// cloud API (awsRecognizer) or run entirely offline (dlibRecognizer).
+type Recognizer interface {
+	// SearchFaces returns known faces that match the given JPEG-encoded face
+	// crop, best match first. An empty result means the face is unknown.
+	SearchFaces(jpegBytes []byte) ([]FaceMatch, error)
+
+	// IndexFace enrolls the given JPEG-encoded face crop under key so that
+	// later SearchFaces calls can recognize it.
+	IndexFace(key FaceKey, jpegBytes []byte) error
+
+	// ListFaces returns every key currently enrolled in the backend.
+	ListFaces() ([]FaceKey, error)
+
+	// Close releases any resources (native handles, persisted index, etc.)
+	// held by the backend.
+	Close() error
+}
+
+// watch reconciles the catalogue images the store knows about with the faces
+// already enrolled in the recognizer, indexing anything new whenever the
+// store reports a change.
+func watch(store Store, recognizer Recognizer) error {
+	synccb := func(locals []FaceKey) error {
+		registered, err := recognizer.ListFaces()
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+
+		newkeys := []FaceKey{}
+		for _, k := range locals {
+			func() {
+				for _, k2 := range registered {
+					if k == k2 {
+						return
+					}
+				}
+				newkeys = append(newkeys, k)
+			}()
+		}
+
+		for _, k := range newkeys {
+			jpegBytes, err := store.ReadImage(k)
+			if err != nil {
+				log.Print("store.ReadImage: ", err)
+				continue
+			}
+			if err := recognizer.IndexFace(k, jpegBytes); err != nil {
+				log.Print("recognizer.IndexFace: ", err)
+				continue
+			}
+			log.Print("Indexed new face: ", k)
+		}
+		return nil
+	}
+
+	return store.Watch(synccb)
+}
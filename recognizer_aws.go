@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+)
+
+// awsRecognizer implements Recognizer on top of an AWS Rekognition
+// collection. It is the original backend this tool shipped with.
+type awsRecognizer struct {
+	reko         *rekognition.Rekognition
+	collectionID string
+}
+
+func newAWSRecognizer(region, accessKeyID, secretAccessKey, collectionID string) (*awsRecognizer, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &awsRecognizer{
+		reko:         rekognition.New(sess),
+		collectionID: collectionID,
+	}, nil
+}
+
+func (r *awsRecognizer) SearchFaces(jpegBytes []byte) ([]FaceMatch, error) {
+	input := &rekognition.SearchFacesByImageInput{
+		CollectionId: aws.String(r.collectionID),
+		Image:        &rekognition.Image{Bytes: jpegBytes},
+	}
+	output, err := r.reko.SearchFacesByImage(input)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	results := []FaceMatch{}
+	for _, f := range output.FaceMatches {
+		if f.Face.ExternalImageId == nil {
+			log.Print("Found but no exterImageId attribute: face_id=", *f.Face.FaceId)
+			continue
+		}
+		k, err := ParseFaceKey(*f.Face.ExternalImageId)
+		if err != nil {
+			continue
+		}
+		results = append(results, FaceMatch{k, *f.Similarity})
+	}
+	return results, nil
+}
+
+func (r *awsRecognizer) IndexFace(key FaceKey, jpegBytes []byte) error {
+	input := &rekognition.IndexFacesInput{
+		CollectionId:    aws.String(r.collectionID),
+		ExternalImageId: aws.String(fmt.Sprintf("%s_%s", key.Name, key.Index)),
+		Image:           &rekognition.Image{Bytes: jpegBytes},
+	}
+	_, err := r.reko.IndexFaces(input)
+	return err
+}
+
+func (r *awsRecognizer) ListFaces() ([]FaceKey, error) {
+	input := &rekognition.ListFacesInput{
+		CollectionId: aws.String(r.collectionID),
+	}
+	output, err := r.reko.ListFaces(input)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	keys := []FaceKey{}
+	for _, f := range output.Faces {
+		if f.ExternalImageId == nil {
+			continue
+		}
+		i := strings.SplitN(*f.ExternalImageId, "_", 2)
+		if len(i) != 2 {
+			log.Print("Skipped externalImageId: ", *f.ExternalImageId)
+			continue
+		}
+		keys = append(keys, FaceKey{i[0], i[1]})
+	}
+	return keys, nil
+}
+
+// Close is a no-op: awsRecognizer holds no local resources, the Rekognition
+// collection lives server-side.
+func (r *awsRecognizer) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Kagami/go-face"
+)
+
+// dlibMatchThreshold is the conventional Euclidean-distance cutoff dlib's
+// face recognition ResNet is tuned for: descriptor pairs closer than this are
+// considered the same person.
+const dlibMatchThreshold = 0.6
+
+// dlibIndexFile is the name of the file, relative to a store's base
+// directory, that the enrolled descriptor index is persisted to.
+const dlibIndexFile = "dlib_index.gob"
+
+// dlibEntry is one enrolled face: its 128-D descriptor plus the catalogue key
+// it was computed from.
+type dlibEntry struct {
+	Key        FaceKey
+	Descriptor face.Descriptor
+}
+
+// dlibRecognizer implements Recognizer using a local dlib-based face
+// recognizer (github.com/Kagami/go-face), so identification works entirely
+// offline with no Rekognition collection required.
+type dlibRecognizer struct {
+	rec       *face.Recognizer
+	indexPath string
+
+	mu      sync.Mutex
+	entries []dlibEntry
+}
+
+// newDlibRecognizer loads the face detector, shape predictor and recognition
+// ResNet model from modelsDir (see go-face's README for the expected file
+// names) and restores any previously persisted index from baseDir.
+func newDlibRecognizer(modelsDir, baseDir string) (*dlibRecognizer, error) {
+	rec, err := face.NewRecognizer(modelsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &dlibRecognizer{
+		rec:       rec,
+		indexPath: filepath.Join(baseDir, dlibIndexFile),
+	}
+	if err := r.loadIndex(); err != nil {
+		rec.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *dlibRecognizer) Close() error {
+	r.rec.Close()
+	return nil
+}
+
+func (r *dlibRecognizer) loadIndex() error {
+	f, err := os.Open(r.indexPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []dlibEntry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		return err
+	}
+	r.entries = entries
+	return nil
+}
+
+// saveIndex persists the enrolled descriptors to disk. Caller must hold r.mu.
+func (r *dlibRecognizer) saveIndex() error {
+	f, err := os.Create(r.indexPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewEncoder(f).Encode(r.entries)
+}
+
+func (r *dlibRecognizer) SearchFaces(jpegBytes []byte) ([]FaceMatch, error) {
+	f, err := r.rec.RecognizeSingle(jpegBytes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if f == nil {
+		// jpegBytes is already a tight crop from the local Haar detector;
+		// dlib simply not finding a face in it means "no match", not an
+		// error, so identify() still falls through to the guest-save path
+		// instead of dropping the frame.
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var best *dlibEntry
+	var bestDist float64
+	for i, e := range r.entries {
+		dist := descriptorDistance(e.Descriptor, f.Descriptor)
+		if best == nil || dist < bestDist {
+			best = &r.entries[i]
+			bestDist = dist
+		}
+	}
+	if best == nil || bestDist > dlibMatchThreshold {
+		return nil, nil
+	}
+
+	// Similarity is reported on the same 0-100 scale Rekognition uses so that
+	// the caller's sort-by-similarity logic keeps working unmodified.
+	similarity := (1 - bestDist/dlibMatchThreshold) * 100
+	return []FaceMatch{{Key: best.Key, Similarity: similarity}}, nil
+}
+
+func (r *dlibRecognizer) IndexFace(key FaceKey, jpegBytes []byte) error {
+	f, err := r.rec.RecognizeSingle(jpegBytes)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return errors.New("no face found in enrollment image")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, dlibEntry{Key: key, Descriptor: f.Descriptor})
+	return r.saveIndex()
+}
+
+func (r *dlibRecognizer) ListFaces() ([]FaceKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]FaceKey, len(r.entries))
+	for i, e := range r.entries {
+		keys[i] = e.Key
+	}
+	return keys, nil
+}
+
+func descriptorDistance(a, b face.Descriptor) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// server exposes the gate-camera appliance over HTTP: enrollment uploads,
+// guest review, a live event stream, and the most recent frame. It turns the
+// tool from a CLI demo into something operable without SSHing in.
+type server struct {
+	store  *safeStore
+	frames *frameCache
+	events *eventBroker
+}
+
+func newServer(store *safeStore, frames *frameCache, events *eventBroker) *server {
+	return &server{store: store, frames: frames, events: events}
+}
+
+// Start blocks serving HTTP on addr. Run it from a goroutine.
+func (s *server) Start(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/catalogue/", s.handleCatalogue)
+	mux.HandleFunc("/guests", s.handleGuests)
+	mux.HandleFunc("/guests/", s.handlePromoteGuest)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/capture.jpg", s.handleCaptureJPEG)
+	mux.HandleFunc("/", s.handleIndex)
+
+	log.Print("HTTP control server listening on ", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// POST /catalogue/{name} - enroll an uploaded JPEG under name. The catalogue
+// watcher picks it up and indexes it on its own.
+func (s *server) handleCatalogue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/catalogue/")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "missing or invalid name", http.StatusBadRequest)
+		return
+	}
+
+	img, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.store.SaveCatalogueImage(name, img)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, key)
+}
+
+// GET /guests - list the unidentified images saved by SaveGuest.
+func (s *server) handleGuests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := s.store.ListGuests()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ids)
+}
+
+// POST /guests/{id}/promote?name=... - move a guest image into the
+// catalogue under name.
+func (s *server) handlePromoteGuest(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/guests/")
+	if !strings.HasSuffix(rest, "/promote") {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimSuffix(rest, "/promote")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.PromoteGuest(id, name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /events - an SSE stream of RecognitionEvents as they happen.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, cancel := s.events.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Print("handleEvents: ", err)
+				continue
+			}
+			if _, err := w.Write(append(append([]byte("data: "), data...), '\n', '\n')); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// GET /capture.jpg - the most recently captured frame.
+func (s *server) handleCaptureJPEG(w http.ResponseWriter, r *http.Request) {
+	jpegBytes := s.frames.Get()
+	if jpegBytes == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(jpegBytes)
+}
+
+// GET / - a small embedded UI for enrollment, guest review and watching
+// live recognition events.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(indexHTML))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print("writeJSON: ", err)
+	}
+}
+
+const indexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gatecam</title>
+</head>
+<body>
+<h1>gatecam</h1>
+
+<h2>Live</h2>
+<img id="live" src="/capture.jpg" width="640" height="480">
+<ul id="events"></ul>
+
+<h2>Enroll</h2>
+<form id="enroll">
+<input type="text" name="name" placeholder="name" required>
+<input type="file" name="image" accept="image/jpeg" required>
+<button type="submit">Upload</button>
+</form>
+
+<h2>Guests</h2>
+<ul id="guests"></ul>
+
+<script>
+function refreshLive() {
+  document.getElementById('live').src = '/capture.jpg?' + Date.now();
+}
+setInterval(refreshLive, 1000);
+
+var events = document.getElementById('events');
+new EventSource('/events').onmessage = function(e) {
+  var ev = JSON.parse(e.data);
+  var li = document.createElement('li');
+  li.textContent = ev.time + ' ' + ev.key.Name + ' (' + ev.similarity.toFixed(1) + '%)';
+  events.insertBefore(li, events.firstChild);
+};
+
+function loadGuests() {
+  fetch('/guests').then(function(r) { return r.json(); }).then(function(ids) {
+    var list = document.getElementById('guests');
+    list.innerHTML = '';
+    (ids || []).forEach(function(id) {
+      var li = document.createElement('li');
+      li.textContent = id + ' ';
+      var name = document.createElement('input');
+      name.placeholder = 'name';
+      var button = document.createElement('button');
+      button.textContent = 'promote';
+      button.onclick = function() {
+        fetch('/guests/' + id + '/promote?name=' + encodeURIComponent(name.value), {method: 'POST'}).then(loadGuests);
+      };
+      li.appendChild(name);
+      li.appendChild(button);
+      list.appendChild(li);
+    });
+  });
+}
+loadGuests();
+setInterval(loadGuests, 5000);
+
+document.getElementById('enroll').onsubmit = function(e) {
+  e.preventDefault();
+  var form = e.target;
+  var name = form.name.value;
+  var file = form.image.files[0];
+  fetch('/catalogue/' + encodeURIComponent(name), {method: 'POST', body: file}).then(function() {
+    form.reset();
+  });
+};
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// safeStore wraps a Store with a mutex so that the HTTP handlers in server.go
+// can call it from request goroutines at the same time the capture loop and
+// catalogue watcher are using it.
+type safeStore struct {
+	mu    sync.Mutex
+	store Store
+}
+
+func newSafeStore(store Store) *safeStore {
+	return &safeStore{store: store}
+}
+
+func (s *safeStore) Setup() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.Setup()
+}
+
+func (s *safeStore) SaveGuest(img []byte, idx int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.SaveGuest(img, idx)
+}
+
+// Watch is deliberately not guarded by s.mu: the underlying Store runs an
+// initial sync synchronously before this call returns, and that sync's
+// SyncFunc calls back into this same safeStore (e.g. ReadImage). Locking
+// here would self-deadlock on the very first sync whenever the catalogue is
+// non-empty.
+func (s *safeStore) Watch(synccb SyncFunc) error {
+	return s.store.Watch(synccb)
+}
+
+func (s *safeStore) ReadImage(key FaceKey) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.ReadImage(key)
+}
+
+func (s *safeStore) RecordDetectedName(now time.Time, key FaceKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.RecordDetectedName(now, key)
+}
+
+func (s *safeStore) ReadMetadata(key FaceKey) (FaceMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.ReadMetadata(key)
+}
+
+func (s *safeStore) BaseDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.BaseDir()
+}
+
+func (s *safeStore) ListGuests() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.ListGuests()
+}
+
+func (s *safeStore) ReadGuest(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.ReadGuest(id)
+}
+
+func (s *safeStore) PromoteGuest(id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.PromoteGuest(id, name)
+}
+
+func (s *safeStore) SaveCatalogueImage(name string, img []byte) (FaceKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store.SaveCatalogueImage(name, img)
+}
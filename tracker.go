@@ -0,0 +1,119 @@
+package main
+
+import (
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// trackerTTL is the longest a tracked face is trusted without being
+// re-identified against the recognizer, even if the tracker itself never
+// loses the target.
+const trackerTTL = 30 * time.Second
+
+// trackerIoUThreshold is the minimum intersection-over-union between a
+// tracker's predicted box and a freshly detected face for the two to be
+// considered the same face. Below this the face is treated as new and
+// re-identified.
+const trackerIoUThreshold = 0.3
+
+// trackedFace remembers a previously identified face so that capture() does
+// not have to call the recognizer again for every frame it stays in view.
+type trackedFace struct {
+	cv         gocv.Tracker
+	key        FaceKey
+	similarity float64
+	rect       image.Rectangle
+	expires    time.Time
+}
+
+// faceTracker holds the set of faces currently being tracked across frames.
+// It is not safe for concurrent use; capture() is expected to own one
+// instance and call it from a single goroutine.
+type faceTracker struct {
+	tracked []*trackedFace
+}
+
+func newFaceTracker() *faceTracker {
+	return &faceTracker{}
+}
+
+// Advance updates every tracker against the current frame, dropping any
+// whose tracker lost the target or whose TTL expired, and returns the faces
+// that are still being tracked.
+func (t *faceTracker) Advance(frame gocv.Mat) []*trackedFace {
+	now := time.Now()
+	live := t.tracked[:0]
+	for _, tf := range t.tracked {
+		if now.After(tf.expires) {
+			tf.cv.Close()
+			continue
+		}
+		rect, ok := tf.cv.Update(frame)
+		if !ok {
+			tf.cv.Close()
+			continue
+		}
+		tf.rect = rect
+		live = append(live, tf)
+	}
+	t.tracked = live
+	return t.tracked
+}
+
+// Match returns the tracked face whose box best overlaps rect, if its IoU is
+// at least trackerIoUThreshold.
+func (t *faceTracker) Match(rect image.Rectangle) *trackedFace {
+	var best *trackedFace
+	var bestIoU float64
+	for _, tf := range t.tracked {
+		iou := intersectionOverUnion(tf.rect, rect)
+		if iou > bestIoU {
+			best, bestIoU = tf, iou
+		}
+	}
+	if bestIoU < trackerIoUThreshold {
+		return nil
+	}
+	return best
+}
+
+// Track starts tracking rect in frame under key, replacing any prior tracker
+// for the same key.
+func (t *faceTracker) Track(frame gocv.Mat, rect image.Rectangle, key FaceKey, similarity float64) {
+	cv := gocv.NewTrackerKCF()
+	if ok := cv.Init(frame, rect); !ok {
+		cv.Close()
+		return
+	}
+
+	for i, tf := range t.tracked {
+		if tf.key == key {
+			tf.cv.Close()
+			t.tracked = append(t.tracked[:i], t.tracked[i+1:]...)
+			break
+		}
+	}
+
+	t.tracked = append(t.tracked, &trackedFace{
+		cv:         cv,
+		key:        key,
+		similarity: similarity,
+		rect:       rect,
+		expires:    time.Now().Add(trackerTTL),
+	})
+}
+
+func intersectionOverUnion(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	interArea := inter.Dx() * inter.Dy()
+	unionArea := a.Dx()*a.Dy() + b.Dx()*b.Dy() - interArea
+	if unionArea <= 0 {
+		return 0
+	}
+	return float64(interArea) / float64(unionArea)
+}